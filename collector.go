@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// collector aggregates conflicts and progress counters from the worker
+// pool. It replaces the single-threaded *[]string notes slice the old
+// recursive checkDir used directly.
+type collector struct {
+	mu        sync.Mutex
+	conflicts []Conflict
+
+	filesChecked int64
+	bytesChecked int64
+	mismatches   int64
+	stopped      int32
+}
+
+func newCollector() *collector {
+	return &collector{}
+}
+
+func (c *collector) addConflict(conflict Conflict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conflicts = append(c.conflicts, conflict)
+}
+
+func (c *collector) Conflicts() []Conflict {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conflicts := make([]Conflict, len(c.conflicts))
+	copy(conflicts, c.conflicts)
+	return conflicts
+}
+
+func (c *collector) recordChecked(bytes int64, mismatch bool) {
+	atomic.AddInt64(&c.filesChecked, 1)
+	atomic.AddInt64(&c.bytesChecked, bytes)
+	if mismatch {
+		atomic.AddInt64(&c.mismatches, 1)
+	}
+}
+
+func (c *collector) snapshot() (files, bytes, mismatches int64) {
+	return atomic.LoadInt64(&c.filesChecked), atomic.LoadInt64(&c.bytesChecked), atomic.LoadInt64(&c.mismatches)
+}
+
+// stop marks the run as having found a conflict under --keep-going=false,
+// so the walker and workers can wind down without enumerating the rest
+// of the tree.
+func (c *collector) stop() {
+	atomic.StoreInt32(&c.stopped, 1)
+}
+
+func (c *collector) isStopped() bool {
+	return atomic.LoadInt32(&c.stopped) == 1
+}
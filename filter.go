@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultIgnoreFileName is looked up at the root of SRC when --ignore-file
+// isn't given, mirroring how .gitignore is found without being named on
+// the command line.
+const defaultIgnoreFileName = ".precopyignore"
+
+// ignorePattern is one line from an ignore file or --exclude flag,
+// gitignore-style: a leading "!" negates a prior match, a trailing "/"
+// restricts the pattern to directories.
+type ignorePattern struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// normalizePattern anchors a slash-free pattern so it matches at any
+// depth (gitignore semantics for "*.log"), and strips a leading slash
+// from an already-anchored one ("/build" -> "build").
+func normalizePattern(pattern string) string {
+	if !strings.Contains(pattern, "/") {
+		return "**/" + pattern
+	}
+	return strings.TrimPrefix(pattern, "/")
+}
+
+func parsePatternLine(line string) (ignorePattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	negate := strings.HasPrefix(line, "!")
+	if negate {
+		line = line[1:]
+	}
+
+	dirOnly := strings.HasSuffix(line, "/")
+	line = strings.TrimSuffix(line, "/")
+
+	return ignorePattern{pattern: normalizePattern(line), negate: negate, dirOnly: dirOnly}, true
+}
+
+// loadIgnoreFile parses a .precopyignore-style file on fs. A missing file
+// is not an error: it just contributes no patterns.
+func loadIgnoreFile(fs FileSystem, path string) ([]ignorePattern, error) {
+	data, err := readAll(fs, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var patterns []ignorePattern
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := parsePatternLine(line); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, nil
+}
+
+// Filter decides, for a path relative to SRC's root, whether the walk
+// should visit it at all.
+type Filter struct {
+	ignore  []ignorePattern
+	include []string
+}
+
+// NewFilter builds a Filter from --exclude flag values (appended after
+// any ignore-file patterns, so they take precedence) and --include flag
+// values.
+func NewFilter(ignoreFilePatterns []ignorePattern, excludeFlags []string, includeFlags []string) *Filter {
+	ignore := append([]ignorePattern{}, ignoreFilePatterns...)
+	for _, e := range excludeFlags {
+		if p, ok := parsePatternLine(e); ok {
+			ignore = append(ignore, p)
+		}
+	}
+
+	include := make([]string, len(includeFlags))
+	for i, pat := range includeFlags {
+		include[i] = normalizePattern(pat)
+	}
+
+	return &Filter{ignore: ignore, include: include}
+}
+
+// excluded applies every ignore pattern in order, gitignore-style: the
+// last pattern that matches wins, and a "!" pattern un-ignores.
+func (f *Filter) excluded(relPath string, isDir bool) bool {
+	excluded := false
+	for _, p := range f.ignore {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchGlob(p.pattern, relPath) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// included reports whether relPath matches an --include pattern. With no
+// --include flags, everything not otherwise excluded is included.
+func (f *Filter) included(relPath string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pat := range f.include {
+		if matchGlob(pat, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the walk should descend into or compare relPath.
+// Directories are never excluded by --include alone, so a whole subtree
+// can still be pruned cheaply by an --exclude/.precopyignore match
+// without requiring every file under it to separately match --include.
+func (f *Filter) Allowed(relPath string, isDir bool) bool {
+	if f.excluded(relPath, isDir) {
+		return false
+	}
+	if isDir {
+		return true
+	}
+	return f.included(relPath)
+}
+
+// matchGlob matches pattern against target path-segment by path-segment,
+// where "**" stands for zero or more segments - the one piece of glob
+// filepath.Match can't express on its own.
+func matchGlob(pattern, target string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(target, "/"))
+}
+
+func matchSegments(pattern, target []string) bool {
+	if len(pattern) == 0 {
+		return len(target) == 0
+	}
+
+	if pattern[0] == "**" {
+		if matchSegments(pattern[1:], target) {
+			return true
+		}
+		return len(target) > 0 && matchSegments(pattern, target[1:])
+	}
+
+	if len(target) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], target[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], target[1:])
+}
@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestMatchGlob_DoubleStarMatchesAnyDepth(t *testing.T) {
+	cases := []struct {
+		pattern, target string
+		want            bool
+	}{
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/c", true},
+		{"a/**/c", "a/b/b2/c", true},
+		{"a/**/c", "a/b", false},
+		{"**/*.log", "x.log", true},
+		{"**/*.log", "a/b/x.log", true},
+		{"**/*.log", "a/b/x.txt", false},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.target); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.target, got, c.want)
+		}
+	}
+}
+
+func TestNormalizePattern(t *testing.T) {
+	if got := normalizePattern("*.log"); got != "**/*.log" {
+		t.Errorf("normalizePattern(*.log) = %q, want **/*.log", got)
+	}
+	if got := normalizePattern("/build"); got != "build" {
+		t.Errorf("normalizePattern(/build) = %q, want build", got)
+	}
+	if got := normalizePattern("a/b"); got != "a/b" {
+		t.Errorf("normalizePattern(a/b) = %q, want a/b", got)
+	}
+}
+
+func parsePatterns(t *testing.T, lines ...string) []ignorePattern {
+	t.Helper()
+	var patterns []ignorePattern
+	for _, line := range lines {
+		if p, ok := parsePatternLine(line); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func TestFilter_NegationReincludesAPreviouslyExcludedPath(t *testing.T) {
+	filter := NewFilter(parsePatterns(t, "*.log", "!keep.log"), nil, nil)
+
+	if filter.Allowed("a.log", false) {
+		t.Error("expected a.log to be excluded")
+	}
+	if !filter.Allowed("keep.log", false) {
+		t.Error("expected keep.log to be re-included by the negated pattern")
+	}
+}
+
+func TestFilter_LastMatchingPatternWins(t *testing.T) {
+	// gitignore semantics: patterns are applied in order and the last
+	// match decides, so re-excluding after a negation works too.
+	filter := NewFilter(parsePatterns(t, "*.log", "!keep.log", "keep.log"), nil, nil)
+	if filter.Allowed("keep.log", false) {
+		t.Error("expected the final re-exclude pattern to win")
+	}
+}
+
+func TestFilter_DirOnlyPatternPrunesOnlyDirectories(t *testing.T) {
+	filter := NewFilter(parsePatterns(t, "node_modules/"), nil, nil)
+
+	if filter.Allowed("node_modules", true) {
+		t.Error("expected the node_modules directory to be excluded")
+	}
+	if !filter.Allowed("node_modules", false) {
+		t.Error("expected a file named node_modules (not a dir) to be unaffected by the dirOnly pattern")
+	}
+}
+
+func TestFilter_DirOnlyPatternPrunesWholeSubtree(t *testing.T) {
+	filter := NewFilter(parsePatterns(t, "build/"), nil, nil)
+
+	if filter.Allowed("build", true) {
+		t.Error("expected build/ to be pruned before the walk descends into it")
+	}
+}
+
+func TestFilter_IncludeRestrictsFilesNotDirectories(t *testing.T) {
+	filter := NewFilter(nil, nil, []string{"*.go"})
+
+	if !filter.Allowed("main.go", false) {
+		t.Error("expected main.go to match the --include pattern")
+	}
+	if filter.Allowed("README.md", false) {
+		t.Error("expected README.md to be rejected: it doesn't match any --include pattern")
+	}
+	if !filter.Allowed("pkg", true) {
+		t.Error("expected directories to remain walkable so --include can still find matches underneath them")
+	}
+}
+
+func TestFilter_ExcludeTakesPrecedenceOverInclude(t *testing.T) {
+	filter := NewFilter(parsePatterns(t, "vendor/"), nil, []string{"*.go"})
+
+	if filter.Allowed("vendor", true) {
+		t.Error("expected --exclude to prune vendor/ even though --include would otherwise admit *.go under it")
+	}
+}
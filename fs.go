@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// File is the subset of *os.File precopy needs to compare content.
+type File interface {
+	io.ReadCloser
+}
+
+// FileSystem is precopy's filesystem abstraction, modeled after afero's
+// afero.Fs: a narrow interface the walker and comparators go through
+// instead of calling the os package directly, so SRC and DEST can each
+// live on a different backend (local disk today; an in-memory backend
+// for tests; sftp/s3 are recognized but not wired up yet).
+type FileSystem interface {
+	Open(name string) (File, error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
+	Stat(name string) (os.FileInfo, error)
+	WriteFile(name string, data []byte) error
+	Readlink(name string) (string, error)
+}
+
+// readAll reads the full content of name on fs.
+func readAll(fs FileSystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// osFS is the default FileSystem, backed directly by the local disk.
+type osFS struct{}
+
+func (osFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+var (
+	memFSRegistryMu sync.Mutex
+	memFSRegistry   = map[string]*memFS{}
+)
+
+// namedMemFS returns the in-memory filesystem registered under name,
+// creating it on first use. mem://shared-name URLs let SRC and DEST
+// arguments in a test reference the same backing store.
+func namedMemFS(name string) *memFS {
+	memFSRegistryMu.Lock()
+	defer memFSRegistryMu.Unlock()
+
+	fs, ok := memFSRegistry[name]
+	if !ok {
+		fs = newMemFS()
+		memFSRegistry[name] = fs
+	}
+	return fs
+}
+
+// resolveFS parses a SRC/DEST argument, returning the FileSystem backend
+// it names and the path within that backend. A bare path (no scheme)
+// resolves to the local disk, matching precopy's historical CLI contract.
+func resolveFS(raw string) (FileSystem, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return osFS{}, raw, nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return osFS{}, u.Path, nil
+	case "mem":
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+		return namedMemFS(u.Host), path, nil
+	case "sftp", "s3":
+		return nil, "", fmt.Errorf("%s:// backend requires an external module not vendored in this build", u.Scheme)
+	default:
+		return nil, "", fmt.Errorf("unsupported backend scheme %q", u.Scheme)
+	}
+}
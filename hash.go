@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// HashAlgo identifies one of the digest algorithms precopy can use to
+// compare file content instead of streaming bytes.
+type HashAlgo string
+
+const (
+	HashNone   HashAlgo = ""
+	HashSHA256 HashAlgo = "sha256"
+	HashMD5    HashAlgo = "md5"
+	HashBlake3 HashAlgo = "blake3"
+	HashXXH64  HashAlgo = "xxh64"
+)
+
+// newHasher returns a hash.Hash for algo, or an error if algo isn't
+// available. blake3 and xxh64 are recognized but not wired up yet: they
+// need an external module that isn't vendored in this tree.
+func newHasher(algo HashAlgo) (hash.Hash, error) {
+	switch algo {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashMD5:
+		return md5.New(), nil
+	case HashBlake3, HashXXH64:
+		return nil, fmt.Errorf("hash algorithm %q requires an external module not vendored in this build", algo)
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algo)
+	}
+}
+
+// fileDigest computes the hex-encoded digest of the file at path (on fs)
+// using algo.
+func fileDigest(fs FileSystem, path string, algo HashAlgo) (string, error) {
+	h, err := newHasher(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
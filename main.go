@@ -8,46 +8,39 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 const chunkSize = 64000
 const exitStatusCopyUnsafe = 3
 const exitStatusOtherErrors = 4
 
-func readDirIntoMap(path string) map[string]os.DirEntry {
-	res := make(map[string]os.DirEntry)
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		reportErrorAndExit(err)
-	}
-	for _, entry := range entries {
-		res[entry.Name()] = entry
-	}
-	return res
-}
-
 func reportErrorAndExit(err error) {
 	fmt.Println(err)
 	os.Exit(exitStatusOtherErrors)
 }
 
-func IsFileContentIdentical(file1, file2 string) bool {
-	f1, err := os.Open(file1)
+// IsFileContentIdentical byte-streams file1 (on fs1) and file2 (on fs2),
+// comparing them chunk by chunk without assuming either lives on the
+// local disk.
+func IsFileContentIdentical(fs1 FileSystem, file1 string, fs2 FileSystem, file2 string) bool {
+	f1, err := fs1.Open(file1)
 	if err != nil {
 		reportErrorAndExit(err)
 	}
-	defer func(f1 *os.File) {
+	defer func(f1 File) {
 		err := f1.Close()
 		if err != nil {
 			reportErrorAndExit(err)
 		}
 	}(f1)
 
-	f2, err := os.Open(file2)
+	f2, err := fs2.Open(file2)
 	if err != nil {
 		reportErrorAndExit(err)
 	}
-	defer func(f2 *os.File) {
+	defer func(f2 File) {
 		err := f2.Close()
 		if err != nil {
 			reportErrorAndExit(err)
@@ -56,98 +49,142 @@ func IsFileContentIdentical(file1, file2 string) bool {
 
 	for {
 		b1 := make([]byte, chunkSize)
-		_, err1 := f1.Read(b1)
+		n1, err1 := io.ReadFull(f1, b1)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			log.Fatal(err1)
+		}
 
 		b2 := make([]byte, chunkSize)
-		_, err2 := f2.Read(b2)
-
-		if err1 != nil || err2 != nil {
-			if err1 == io.EOF && err2 == io.EOF {
-				return true
-			} else if err1 == io.EOF || err2 == io.EOF {
-				return false
-			} else {
-				log.Fatal(err1, err2)
-			}
+		n2, err2 := io.ReadFull(f2, b2)
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			log.Fatal(err2)
 		}
 
-		if !bytes.Equal(b1, b2) {
+		if n1 != n2 || !bytes.Equal(b1[:n1], b2[:n2]) {
 			return false
 		}
+		if n1 < chunkSize {
+			return true
+		}
 	}
 }
 
-func checkDir(sourceDir string, destDir string, notesPtr *[]string) {
-	destEntries := readDirIntoMap(destDir)
-	entries, err := os.ReadDir(sourceDir)
-	if err != nil {
-		reportErrorAndExit(err)
-	}
+func precopyCheck(sourceFS FileSystem, sourceDir string, destFS FileSystem, destDir string, cmp Comparator, jobs int, showProgress bool, filter *Filter, keepGoing bool, checks MetadataChecks, reportFormat string, reportWriter io.Writer) {
+	coll := runComparisons(sourceFS, sourceDir, destFS, destDir, cmp, jobs, showProgress, filter, keepGoing, checks)
+	conflicts := coll.Conflicts()
 
-	for _, sourceEntry := range entries {
-		destEntry, found := destEntries[sourceEntry.Name()]
-		if found {
-			sourcePath := filepath.Join(sourceDir, sourceEntry.Name())
-			destPath := filepath.Join(destDir, destEntry.Name())
-			if sourceEntry.IsDir() && destEntry.IsDir() {
-				checkDir(sourcePath, destPath, notesPtr)
-			} else if sourceEntry.IsDir() != destEntry.IsDir() {
-				msg := fmt.Sprintf("'%s' and '%s' have different types", sourcePath, destPath)
-				*notesPtr = append(*notesPtr, msg)
-				fmt.Println(msg)
-			} else {
-				sourceInfo, err := sourceEntry.Info()
-				if err != nil {
-					reportErrorAndExit(err)
-				}
-				destInfo, err := destEntry.Info()
-				if err != nil {
-					reportErrorAndExit(err)
-				}
-				if sourceInfo.Size() != destInfo.Size() {
-					msg := fmt.Sprintf("'%s' and '%s' have different sizes", sourcePath, destPath)
-					*notesPtr = append(*notesPtr, msg)
-					fmt.Println(msg)
-				} else if !IsFileContentIdentical(sourcePath, destPath) {
-					msg := fmt.Sprintf("'%s' and '%s' content differs", sourcePath, destPath)
-					*notesPtr = append(*notesPtr, msg)
-					fmt.Println(msg)
-				}
-			}
-		}
+	if err := writeReport(reportFormat, conflicts, reportWriter); err != nil {
+		reportErrorAndExit(err)
 	}
-}
-
-func precopyCheck(sourceDir string, destDir string) {
-	var notes []string
-	checkDir(sourceDir, destDir, &notes)
 
-	if len(notes) == 0 {
+	if len(conflicts) == 0 {
 		fmt.Println("Safe to copy")
 	} else {
 		fmt.Println("It may be unsafe")
 		os.Exit(exitStatusCopyUnsafe)
-		//for _, note := range notes {
-		//	fmt.Println(note)
-		//}
 	}
 }
 
+// stringList accumulates one value per occurrence of a repeatable flag,
+// e.g. --exclude '*.log' --exclude '.git/'.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func main() {
 	helpPtr := flag.Bool("help", false, "show usage")
+	hashPtr := flag.String("hash", "", "compare file content by digest instead of byte-streaming (sha256|md5|blake3|xxh64)")
+	comparePtr := flag.String("compare", "", "how to compare same-sized files: size|bytes|hash (default bytes, or hash when --hash is set)")
+	jobsPtr := flag.Int("jobs", runtime.NumCPU(), "number of worker goroutines comparing files concurrently")
+	progressPtr := flag.Bool("progress", false, "print a files/bytes/mismatches tally every second")
+	ignoreFilePtr := flag.String("ignore-file", "", "gitignore-style ignore file (default: .precopyignore at SRC's root)")
+	dryRunPtr := flag.Bool("dry-run", false, "list the paths --include/--exclude would admit, without comparing them")
+	reportPtr := flag.String("report", "text", "conflict report format: text|json|ndjson|csv")
+	reportFilePtr := flag.String("report-file", "", "write the report here instead of stdout")
+	keepGoingPtr := flag.Bool("keep-going", false, "enumerate every conflict instead of stopping at the first")
+	checkModePtr := flag.Bool("check-mode", false, "flag permission differences between matched pairs, even when content matches")
+	checkOwnerPtr := flag.Bool("check-owner", false, "flag uid/gid differences between matched pairs, even when content matches")
+	checkXattrPtr := flag.Bool("check-xattr", false, "UNIMPLEMENTED: always errors. Flagging xattr differences needs golang.org/x/sys/unix, not vendored in this build")
+	var includeFlags, excludeFlags stringList
+	flag.Var(&includeFlags, "include", "glob (gitignore-style, ** allowed) a path must match to be compared; repeatable")
+	flag.Var(&excludeFlags, "exclude", "glob (gitignore-style, ** allowed) to prune from the walk; repeatable")
 	flag.Parse()
 
 	if *helpPtr || flag.Arg(0) == "" || flag.Arg(1) == "" {
-		fmt.Println("Usage: precopy SRC DEST")
+		fmt.Println("Usage: precopy [--hash=sha256|md5|blake3|xxh64] [--compare=size|bytes|hash] [--jobs=N] [--progress]")
+		fmt.Println("               [--include=GLOB]... [--exclude=GLOB]... [--ignore-file=PATH] [--dry-run]")
+		fmt.Println("               [--report=text|json|ndjson|csv] [--report-file=PATH] [--keep-going]")
+		fmt.Println("               [--check-mode] [--check-owner] [--check-xattr] SRC DEST")
+		fmt.Println("SRC and DEST are plain paths on the local disk by default, or a URL such as file:///abs/path or mem://name for a named in-memory store")
 		fmt.Println("Exit status is only zero when merging folders is safe, so that you could chain it with rsync, e.g.:")
 		fmt.Println("precopy src_folder dest_folder && rsync -ra --remove-sent-files src_folder/ dest_folder")
 		fmt.Println("(Note the trailing slash with the first rsync argument")
+		fmt.Println("--hash trades byte-exact comparison for a cached digest comparison, persisted per directory in .precopy-manifest.json")
+		fmt.Println("--jobs controls how many files are compared concurrently; --progress prints a running tally while it works")
+		fmt.Println("--include/--exclude/--ignore-file scope the walk to a subset of SRC; --dry-run lists what they'd admit")
+		fmt.Println("--report controls the conflict record format; --keep-going enumerates every conflict instead of stopping at the first")
+		fmt.Println("symlinks are compared by target, and hardlinked SRC files warn if DEST wouldn't keep them linked")
+		fmt.Println("--check-mode/--check-owner flag metadata differences even when a pair's content matches")
+		fmt.Println("--check-xattr is UNIMPLEMENTED and always errors: it needs golang.org/x/sys/unix, which isn't vendored in this build")
 		os.Exit(0)
 	}
 
-	sourceDir := flag.Arg(0)
-	destDir := flag.Arg(1)
+	if *checkXattrPtr {
+		reportErrorAndExit(fmt.Errorf("--check-xattr requires golang.org/x/sys/unix, not vendored in this build"))
+	}
+
+	hashAlgo := HashAlgo(*hashPtr)
+	if hashAlgo != HashNone {
+		if _, err := newHasher(hashAlgo); err != nil {
+			reportErrorAndExit(err)
+		}
+	}
+
+	cmp, err := newComparator(*comparePtr, hashAlgo)
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+
+	sourceFS, sourceDir, err := resolveFS(flag.Arg(0))
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+	destFS, destDir, err := resolveFS(flag.Arg(1))
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+
+	ignoreFilePath := *ignoreFilePtr
+	if ignoreFilePath == "" {
+		ignoreFilePath = filepath.Join(sourceDir, defaultIgnoreFileName)
+	}
+	ignorePatterns, err := loadIgnoreFile(sourceFS, ignoreFilePath)
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+	filter := NewFilter(ignorePatterns, excludeFlags, includeFlags)
+
+	if *dryRunPtr {
+		runDryRun(sourceFS, sourceDir, destFS, destDir, filter)
+		return
+	}
+
+	reportWriter := io.Writer(os.Stdout)
+	if *reportFilePtr != "" {
+		reportFile, err := os.Create(*reportFilePtr)
+		if err != nil {
+			reportErrorAndExit(err)
+		}
+		defer reportFile.Close()
+		reportWriter = reportFile
+	}
+
+	checks := MetadataChecks{Mode: *checkModePtr, Owner: *checkOwnerPtr}
 
-	fmt.Printf("Checking before copying from '%s' to '%s'\n", sourceDir, destDir)
-	precopyCheck(sourceDir, destDir)
+	fmt.Printf("Checking before copying from '%s' to '%s'\n", flag.Arg(0), flag.Arg(1))
+	precopyCheck(sourceFS, sourceDir, destFS, destDir, cmp, *jobsPtr, *progressPtr, filter, *keepGoingPtr, checks, *reportPtr, reportWriter)
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// manifestFileName is the sidecar cache precopy leaves behind in every
+// directory it hashes, so a repeated run (or a chained precopy before an
+// rsync) doesn't have to recompute digests for files that haven't changed.
+const manifestFileName = ".precopy-manifest.json"
+
+// manifestEntry caches the digest computed for one file, keyed by the
+// (size, mtime) stat tuple that was true when it was computed.
+type manifestEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Algo    string `json:"algo"`
+	Digest  string `json:"digest"`
+}
+
+// manifest maps a file's name within its directory to its cached entry.
+type manifest map[string]manifestEntry
+
+// loadManifest reads the sidecar manifest for dir on fs, returning an
+// empty manifest if none exists yet or it can't be parsed.
+func loadManifest(fs FileSystem, dir string) manifest {
+	data, err := readAll(fs, filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return manifest{}
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return manifest{}
+	}
+	return m
+}
+
+// saveManifest writes m as the sidecar manifest for dir on fs.
+func saveManifest(fs FileSystem, dir string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fs.WriteFile(filepath.Join(dir, manifestFileName), data)
+}
+
+// digestWithCache returns the digest for the file at path (on fs), reusing
+// m's cached entry for name when its (size, mtime, algo) still matches
+// info, and otherwise recomputing it and updating m in place.
+func digestWithCache(fs FileSystem, path, name string, info os.FileInfo, algo HashAlgo, m manifest) (string, error) {
+	if entry, ok := m[name]; ok &&
+		entry.Algo == string(algo) &&
+		entry.Size == info.Size() &&
+		entry.ModTime == info.ModTime().UnixNano() {
+		return entry.Digest, nil
+	}
+
+	digest, err := fileDigest(fs, path, algo)
+	if err != nil {
+		return "", err
+	}
+
+	m[name] = manifestEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Algo:    string(algo),
+		Digest:  digest,
+	}
+	return digest, nil
+}
+
+// dirManifest guards one directory's manifest so concurrent workers can
+// hash files from the same directory without racing on the cache.
+type dirManifest struct {
+	fs    FileSystem
+	dir   string
+	mu    sync.Mutex
+	m     manifest
+	dirty bool
+}
+
+// manifestStore lazily loads and caches a dirManifest per (fs, directory)
+// pair, shared by every worker in the pool, and flushes every touched
+// manifest back to disk once the pool has drained.
+type manifestStore struct {
+	mu   sync.Mutex
+	dirs map[string]*dirManifest
+}
+
+func newManifestStore() *manifestStore {
+	return &manifestStore{dirs: make(map[string]*dirManifest)}
+}
+
+// dirKey disambiguates directories with the same path on different
+// backends (e.g. a local SRC and a mem:// DEST sharing "/tmp/data").
+func dirKey(fs FileSystem, dir string) string {
+	return fmt.Sprintf("%p:%s", fs, dir)
+}
+
+func (s *manifestStore) dirManifestFor(fs FileSystem, dir string) *dirManifest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := dirKey(fs, dir)
+	dm, ok := s.dirs[key]
+	if !ok {
+		dm = &dirManifest{fs: fs, dir: dir, m: loadManifest(fs, dir)}
+		s.dirs[key] = dm
+	}
+	return dm
+}
+
+// digest returns the cached or freshly computed digest for path (inside
+// dir on fs, cached under name), marking dir's manifest dirty on a cache
+// miss.
+func (s *manifestStore) digest(fs FileSystem, dir, path, name string, info os.FileInfo, algo HashAlgo) (string, error) {
+	dm := s.dirManifestFor(fs, dir)
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	before := dm.m[name]
+	digest, err := digestWithCache(fs, path, name, info, algo, dm.m)
+	if err != nil {
+		return "", err
+	}
+	if dm.m[name] != before {
+		dm.dirty = true
+	}
+	return digest, nil
+}
+
+// flush persists every dirty manifest touched during the run.
+func (s *manifestStore) flush() error {
+	s.mu.Lock()
+	dms := make([]*dirManifest, 0, len(s.dirs))
+	for _, dm := range s.dirs {
+		dms = append(dms, dm)
+	}
+	s.mu.Unlock()
+
+	for _, dm := range dms {
+		dm.mu.Lock()
+		dirty := dm.dirty
+		fs, dir, m := dm.fs, dm.dir, dm.m
+		dm.mu.Unlock()
+
+		if dirty {
+			if err := saveManifest(fs, dir, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
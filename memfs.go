@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFile is one entry in a memFS: either a regular file's content or a
+// directory marker.
+type memFile struct {
+	isDir   bool
+	data    []byte
+	modTime time.Time
+}
+
+// memFS is an in-memory FileSystem, used by tests so the comparison
+// logic can be exercised without touching the real disk.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{"/": {isDir: true}}}
+}
+
+func cleanMemPath(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return path.Clean(name)
+}
+
+// WriteFile stores data at name, creating any parent directories implied
+// by the path. It also implements the FileSystem interface, so tests can
+// seed a memFS the same way precopy itself writes a manifest.
+func (m *memFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = cleanMemPath(name)
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; !ok {
+			m.files[dir] = &memFile{isDir: true}
+		}
+	}
+
+	stored := make([]byte, len(data))
+	copy(stored, data)
+	m.files[name] = &memFile{data: stored, modTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = cleanMemPath(name)
+	f, ok := m.files[name]
+	if !ok || f.isDir {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = cleanMemPath(name)
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memFileInfo{name: path.Base(name), file: f}, nil
+}
+
+func (m *memFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dirname = cleanMemPath(dirname)
+	if f, ok := m.files[dirname]; !ok || !f.isDir {
+		return nil, &os.PathError{Op: "readdir", Path: dirname, Err: os.ErrNotExist}
+	}
+
+	seen := map[string]bool{}
+	var infos []os.FileInfo
+	for name, f := range m.files {
+		if name == dirname {
+			continue
+		}
+		dir, base := path.Dir(name), path.Base(name)
+		if dir != dirname || seen[base] {
+			continue
+		}
+		seen[base] = true
+		infos = append(infos, memFileInfo{name: base, file: f})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// Readlink is unsupported: memFS has no notion of a symlink, it only
+// models regular files and directories.
+func (m *memFS) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+}
+
+// memFileInfo implements os.FileInfo for an entry stored in a memFS.
+type memFileInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i memFileInfo) IsDir() bool        { return i.file.isDir }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) Mode() os.FileMode {
+	if i.file.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// EntryKind classifies a directory entry for the walker:
+// os.FileInfo.IsDir() alone can't tell a symlink, socket, or device
+// apart from a regular file, which is how an rsync that would clobber a
+// symlink with a regular file used to get reported as safe.
+type EntryKind string
+
+const (
+	EntryKindFile    EntryKind = "file"
+	EntryKindDir     EntryKind = "dir"
+	EntryKindSymlink EntryKind = "symlink"
+	EntryKindOther   EntryKind = "other"
+)
+
+func classify(info os.FileInfo) EntryKind {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return EntryKindSymlink
+	case info.IsDir():
+		return EntryKindDir
+	case info.Mode().IsRegular():
+		return EntryKindFile
+	default:
+		return EntryKindOther
+	}
+}
+
+// MetadataChecks selects which opt-in metadata comparisons run alongside
+// the default type/size/content checks.
+type MetadataChecks struct {
+	Mode  bool
+	Owner bool
+}
+
+// checkMetadata flags permission and ownership differences between a
+// matched source/dest pair, even when their content is identical.
+func checkMetadata(sourcePath, destPath string, sourceInfo, destInfo os.FileInfo, checks MetadataChecks, coll *collector, keepGoing bool) {
+	if checks.Mode && sourceInfo.Mode().Perm() != destInfo.Mode().Perm() {
+		coll.addConflict(Conflict{
+			PathSrc: sourcePath, PathDst: destPath, Kind: ConflictModeMismatch,
+			SizeSrc: sourceInfo.Size(), SizeDst: destInfo.Size(),
+		})
+		if !keepGoing {
+			coll.stop()
+		}
+	}
+
+	if checks.Owner {
+		sourceUID, sourceGID, sourceOK := ownerOf(sourceInfo)
+		destUID, destGID, destOK := ownerOf(destInfo)
+		if sourceOK && destOK && (sourceUID != destUID || sourceGID != destGID) {
+			coll.addConflict(Conflict{
+				PathSrc: sourcePath, PathDst: destPath, Kind: ConflictOwnerMismatch,
+				SizeSrc: sourceInfo.Size(), SizeDst: destInfo.Size(),
+			})
+			if !keepGoing {
+				coll.stop()
+			}
+		}
+	}
+}
+
+// hardlinkKey identifies an inode on one filesystem (dev, ino) - the same
+// file can share its key across several paths if it's hardlinked.
+type hardlinkKey struct {
+	dev uint64
+	ino uint64
+}
+
+type hardlinkPair struct {
+	sourcePath string
+	destPath   string
+}
+
+// hardlinkTracker groups source paths by the inode they share, so a copy
+// that would silently split a hardlink (the dest already has, or will
+// end up with, independent copies instead of one shared inode) can be
+// flagged. Built up concurrently as the walk visits each regular file.
+type hardlinkTracker struct {
+	mu     sync.Mutex
+	groups map[hardlinkKey][]hardlinkPair
+}
+
+func newHardlinkTracker() *hardlinkTracker {
+	return &hardlinkTracker{groups: make(map[hardlinkKey][]hardlinkPair)}
+}
+
+func (t *hardlinkTracker) record(sourcePath, destPath string, sourceInfo os.FileInfo) {
+	dev, ino, ok := devIno(sourceInfo)
+	if !ok {
+		return
+	}
+
+	key := hardlinkKey{dev: dev, ino: ino}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.groups[key] = append(t.groups[key], hardlinkPair{sourcePath: sourcePath, destPath: destPath})
+}
+
+// checkBreaks reports a hardlink_break conflict for every member of a
+// source-side hardlink group whose dest counterpart doesn't share the
+// first member's dest inode, i.e. copying would stop sharing their data.
+func (t *hardlinkTracker) checkBreaks(destFS FileSystem, coll *collector, keepGoing bool) {
+	t.mu.Lock()
+	groups := make([][]hardlinkPair, 0, len(t.groups))
+	for _, group := range t.groups {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, group := range groups {
+		if !keepGoing && coll.isStopped() {
+			return
+		}
+
+		canonical := group[0]
+		canonicalInfo, err := destFS.Stat(canonical.destPath)
+		if err != nil {
+			continue
+		}
+		canonicalDev, canonicalIno, ok := devIno(canonicalInfo)
+		if !ok {
+			continue
+		}
+
+		for _, other := range group[1:] {
+			otherInfo, err := destFS.Stat(other.destPath)
+			sameInDest := err == nil
+			if sameInDest {
+				otherDev, otherIno, ok := devIno(otherInfo)
+				sameInDest = ok && otherDev == canonicalDev && otherIno == canonicalIno
+			}
+			if !sameInDest {
+				coll.addConflict(Conflict{
+					PathSrc: canonical.sourcePath, PathDst: canonical.destPath, Kind: ConflictHardlinkBreak,
+					PathSrc2: other.sourcePath,
+				})
+				if !keepGoing {
+					coll.stop()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// devIno has no portable equivalent off Unix, so hardlink detection is
+// simply unavailable there: every caller treats ok=false as "skip".
+func devIno(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+// ownerOf has no portable equivalent off Unix.
+func ownerOf(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// These exercise the metadata-conflict paths against the real disk, since
+// memFS has no notion of symlinks or a Sys()-backed dev/inode/uid/gid -
+// devIno/ownerOf just return ok=false for it.
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+func TestDevIno_IdentifiesHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "hello")
+	if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatalf("Link: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "c.txt"), "hello")
+
+	infoA, err := os.Stat(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoB, err := os.Stat(filepath.Join(dir, "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoC, err := os.Stat(filepath.Join(dir, "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devA, inoA, ok := devIno(infoA)
+	if !ok {
+		t.Fatal("expected devIno to report ok=true on a real file")
+	}
+	devB, inoB, ok := devIno(infoB)
+	if !ok || devA != devB || inoA != inoB {
+		t.Fatalf("hardlinked files should share (dev, ino): a=(%d,%d) b=(%d,%d) ok=%v", devA, inoA, devB, inoB, ok)
+	}
+	devC, inoC, ok := devIno(infoC)
+	if !ok || (devA == devC && inoA == inoC) {
+		t.Fatalf("unrelated file should not share inode with a.txt: a=(%d,%d) c=(%d,%d)", devA, inoA, devC, inoC)
+	}
+}
+
+func TestOwnerOf_ReportsCurrentUser(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "hello")
+
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, gid, ok := ownerOf(info)
+	if !ok {
+		t.Fatal("expected ownerOf to report ok=true on a real file")
+	}
+	if int(uid) != os.Getuid() || int(gid) != os.Getgid() {
+		t.Fatalf("got uid=%d gid=%d, want uid=%d gid=%d", uid, gid, os.Getuid(), os.Getgid())
+	}
+}
+
+func TestWalk_DetectsSymlinkMismatch(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "other.txt"), "hello")
+	if err := os.Symlink("a.txt", filepath.Join(srcDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("other.txt", filepath.Join(dstDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	coll := newCollector()
+	walk(osFS{}, srcDir, osFS{}, dstDir, srcDir, NewFilter(nil, nil, nil), coll, true, MetadataChecks{}, nil, func(job) {})
+
+	conflicts := coll.Conflicts()
+	var found bool
+	for _, c := range conflicts {
+		if c.Kind == ConflictSymlinkMismatch {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected a symlink_mismatch conflict, got %v", conflicts)
+	}
+}
+
+func TestWalk_SymlinksToSameTargetAreSafe(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	if err := os.Symlink("a.txt", filepath.Join(srcDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dstDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	coll := newCollector()
+	walk(osFS{}, srcDir, osFS{}, dstDir, srcDir, NewFilter(nil, nil, nil), coll, true, MetadataChecks{}, nil, func(job) {})
+
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts for identical symlink targets, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_DetectsHardlinkBreak(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	if err := os.Link(filepath.Join(srcDir, "a.txt"), filepath.Join(srcDir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// DEST gets two independent copies instead of a shared inode.
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "b.txt"), "hello")
+
+	coll := runComparisons(osFS{}, srcDir, osFS{}, dstDir, byteComparator{}, 1, false, NewFilter(nil, nil, nil), true, MetadataChecks{})
+
+	conflicts := coll.Conflicts()
+	var broken *Conflict
+	for i := range conflicts {
+		if conflicts[i].Kind == ConflictHardlinkBreak {
+			broken = &conflicts[i]
+		}
+	}
+	if broken == nil {
+		t.Fatalf("expected a hardlink_break conflict, got %v", conflicts)
+	}
+	if broken.PathDst == "" || broken.PathSrc2 == "" {
+		t.Fatalf("expected PathDst and PathSrc2 to be populated, got %+v", broken)
+	}
+}
+
+func TestRunComparisons_HardlinkPreservedIsSafe(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	if err := os.Link(filepath.Join(srcDir, "a.txt"), filepath.Join(srcDir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	if err := os.Link(filepath.Join(dstDir, "a.txt"), filepath.Join(dstDir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	coll := runComparisons(osFS{}, srcDir, osFS{}, dstDir, byteComparator{}, 1, false, NewFilter(nil, nil, nil), true, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts when DEST preserves the hardlink, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_DetectsModeMismatch(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	if err := os.Chmod(filepath.Join(dstDir, "a.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	coll := runComparisons(osFS{}, srcDir, osFS{}, dstDir, byteComparator{}, 1, false, NewFilter(nil, nil, nil), true, MetadataChecks{Mode: true})
+	conflicts := coll.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Kind != ConflictModeMismatch {
+		t.Fatalf("expected one mode_mismatch conflict, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_ModeMismatchIgnoredWithoutCheckMode(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(srcDir, "a.txt"), "hello")
+	writeFile(t, filepath.Join(dstDir, "a.txt"), "hello")
+	if err := os.Chmod(filepath.Join(dstDir, "a.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	coll := runComparisons(osFS{}, srcDir, osFS{}, dstDir, byteComparator{}, 1, false, NewFilter(nil, nil, nil), true, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected mode differences to be ignored without --check-mode, got %v", conflicts)
+	}
+}
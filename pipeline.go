@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// job describes one source/dest file pair awaiting comparison. Directory
+// entries and type mismatches are resolved by the walker itself and never
+// turned into jobs.
+type job struct {
+	sourceFS   FileSystem
+	destFS     FileSystem
+	sourceDir  string
+	destDir    string
+	name       string
+	sourcePath string
+	destPath   string
+	sourceInfo os.FileInfo
+	destInfo   os.FileInfo
+}
+
+// walk recurses sourceDir (on sourceFS) and destDir (on destFS), pruning
+// any path filter rejects, always skipping manifestFileName (its content
+// records the mtimes of the files beside it, which usually differ between
+// SRC and DEST, so it would show up as a conflict of its own), reporting
+// type mismatches directly, and calling visit
+// for every file pair that needs comparing. rootSourceDir
+// anchors the path filter is matched against, since patterns like
+// "node_modules/" are relative to SRC's root, not the directory currently
+// being walked. Unless keepGoing is set, the walk winds down as soon as
+// coll reports a conflict was already found.
+func walk(sourceFS FileSystem, sourceDir string, destFS FileSystem, destDir string, rootSourceDir string, filter *Filter, coll *collector, keepGoing bool, checks MetadataChecks, tracker *hardlinkTracker, visit func(job)) {
+	if !keepGoing && coll.isStopped() {
+		return
+	}
+
+	destInfos, err := destFS.ReadDir(destDir)
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+	destEntries := make(map[string]os.FileInfo, len(destInfos))
+	for _, info := range destInfos {
+		destEntries[info.Name()] = info
+	}
+
+	sourceInfos, err := sourceFS.ReadDir(sourceDir)
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+
+	relDir, err := filepath.Rel(rootSourceDir, sourceDir)
+	if err != nil {
+		reportErrorAndExit(err)
+	}
+
+	for _, sourceInfo := range sourceInfos {
+		if !keepGoing && coll.isStopped() {
+			return
+		}
+
+		if sourceInfo.Name() == manifestFileName {
+			continue
+		}
+
+		destInfo, found := destEntries[sourceInfo.Name()]
+		if !found {
+			continue
+		}
+
+		relPath := filepath.ToSlash(filepath.Join(relDir, sourceInfo.Name()))
+		if !filter.Allowed(relPath, sourceInfo.IsDir()) {
+			continue
+		}
+
+		sourcePath := filepath.Join(sourceDir, sourceInfo.Name())
+		destPath := filepath.Join(destDir, destInfo.Name())
+
+		sourceKind, destKind := classify(sourceInfo), classify(destInfo)
+		if sourceKind != destKind {
+			coll.addConflict(Conflict{
+				PathSrc: sourcePath, PathDst: destPath, Kind: ConflictTypeMismatch,
+				SizeSrc: sourceInfo.Size(), SizeDst: destInfo.Size(),
+			})
+			if !keepGoing {
+				coll.stop()
+			}
+			continue
+		}
+
+		checkMetadata(sourcePath, destPath, sourceInfo, destInfo, checks, coll, keepGoing)
+		if !keepGoing && coll.isStopped() {
+			return
+		}
+
+		if sourceKind == EntryKindDir {
+			walk(sourceFS, sourcePath, destFS, destPath, rootSourceDir, filter, coll, keepGoing, checks, tracker, visit)
+			continue
+		}
+
+		if sourceKind == EntryKindSymlink {
+			sourceTarget, err := sourceFS.Readlink(sourcePath)
+			if err != nil {
+				reportErrorAndExit(err)
+			}
+			destTarget, err := destFS.Readlink(destPath)
+			if err != nil {
+				reportErrorAndExit(err)
+			}
+			if sourceTarget != destTarget {
+				coll.addConflict(Conflict{PathSrc: sourcePath, PathDst: destPath, Kind: ConflictSymlinkMismatch})
+				if !keepGoing {
+					coll.stop()
+				}
+			}
+			continue
+		}
+
+		if sourceKind == EntryKindOther {
+			// Sockets, devices, and other special files have no portable
+			// notion of "content", so there's nothing left to compare.
+			continue
+		}
+
+		if tracker != nil {
+			tracker.record(sourcePath, destPath, sourceInfo)
+		}
+
+		visit(job{
+			sourceFS:   sourceFS,
+			destFS:     destFS,
+			sourceDir:  sourceDir,
+			destDir:    destDir,
+			name:       sourceInfo.Name(),
+			sourcePath: sourcePath,
+			destPath:   destPath,
+			sourceInfo: sourceInfo,
+			destInfo:   destInfo,
+		})
+	}
+}
+
+// runComparisons walks sourceDir/destDir and compares every file pair the
+// filter admits using cmp, spreading the comparisons across workerCount
+// workers. Unless keepGoing is set, the run winds down as soon as the
+// first conflict is found instead of enumerating the whole tree. When
+// showProgress is set, a running files/bytes/mismatches tally is printed
+// every second until the walk and all workers have finished. checks
+// selects which opt-in metadata comparisons run alongside the default
+// ones; hardlink groups discovered in SRC are checked against DEST once
+// the walk completes.
+func runComparisons(sourceFS FileSystem, sourceDir string, destFS FileSystem, destDir string, cmp Comparator, workerCount int, showProgress bool, filter *Filter, keepGoing bool, checks MetadataChecks) *collector {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	jobs := make(chan job, workerCount*4)
+	coll := newCollector()
+
+	var workers sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				if !keepGoing && coll.isStopped() {
+					continue
+				}
+				conflict, err := cmp.Compare(j)
+				if err != nil {
+					reportErrorAndExit(err)
+				}
+				coll.recordChecked(j.sourceInfo.Size(), conflict != nil)
+				if conflict != nil {
+					coll.addConflict(*conflict)
+					if !keepGoing {
+						coll.stop()
+					}
+				}
+			}
+		}()
+	}
+
+	var progressDone chan struct{}
+	if showProgress {
+		progressDone = make(chan struct{})
+		go reportProgress(coll, progressDone)
+	}
+
+	tracker := newHardlinkTracker()
+	walk(sourceFS, sourceDir, destFS, destDir, sourceDir, filter, coll, keepGoing, checks, tracker, func(j job) { jobs <- j })
+	close(jobs)
+	workers.Wait()
+
+	if showProgress {
+		close(progressDone)
+	}
+
+	if hc, ok := cmp.(*hashComparator); ok {
+		if err := hc.store.flush(); err != nil {
+			reportErrorAndExit(err)
+		}
+	}
+
+	tracker.checkBreaks(destFS, coll, keepGoing)
+
+	return coll
+}
+
+// runDryRun walks sourceDir/destDir and prints the SRC path of every file
+// pair the filter would admit, without comparing any of them, so users can audit their
+// --include/--exclude patterns before chaining precopy with rsync.
+func runDryRun(sourceFS FileSystem, sourceDir string, destFS FileSystem, destDir string, filter *Filter) {
+	coll := newCollector()
+	walk(sourceFS, sourceDir, destFS, destDir, sourceDir, filter, coll, true, MetadataChecks{}, nil, func(j job) {
+		fmt.Println(j.sourcePath)
+	})
+}
+
+// reportProgress prints a files-checked / bytes-checked / mismatches
+// tally once a second until done is closed.
+func reportProgress(coll *collector, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			files, bytes, mismatches := coll.snapshot()
+			fmt.Printf("progress: %d files checked, %d bytes checked, %d mismatches\n", files, bytes, mismatches)
+		case <-done:
+			files, bytes, mismatches := coll.snapshot()
+			fmt.Printf("progress: %d files checked, %d bytes checked, %d mismatches (done)\n", files, bytes, mismatches)
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func seedMemFS(t *testing.T, files map[string]string) *memFS {
+	t.Helper()
+	fs := newMemFS()
+	for name, content := range files {
+		if err := fs.WriteFile(name, []byte(content)); err != nil {
+			t.Fatalf("seeding %s: %v", name, err)
+		}
+	}
+	return fs
+}
+
+func TestRunComparisons_SafeWhenIdentical(t *testing.T) {
+	src := seedMemFS(t, map[string]string{"/root/a.txt": "hello"})
+	dst := seedMemFS(t, map[string]string{"/root/a.txt": "hello"})
+
+	coll := runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, NewFilter(nil, nil, nil), false, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_DetectsContentMismatch(t *testing.T) {
+	src := seedMemFS(t, map[string]string{"/root/a.txt": "hello"})
+	dst := seedMemFS(t, map[string]string{"/root/a.txt": "world"})
+
+	coll := runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, NewFilter(nil, nil, nil), false, MetadataChecks{})
+	conflicts := coll.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Kind != ConflictContentMismatch {
+		t.Fatalf("expected one content_mismatch conflict, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_FilterExcludesPath(t *testing.T) {
+	src := seedMemFS(t, map[string]string{"/root/a.txt": "hello", "/root/skip.txt": "hello"})
+	dst := seedMemFS(t, map[string]string{"/root/a.txt": "hello", "/root/skip.txt": "world"})
+
+	filter := NewFilter(nil, []string{"skip.txt"}, nil)
+	coll := runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, filter, false, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected skip.txt to be excluded from comparison, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_IgnoresManifestSidecar(t *testing.T) {
+	src := seedMemFS(t, map[string]string{"/root/a.txt": "hello"})
+	dst := seedMemFS(t, map[string]string{"/root/a.txt": "hello"})
+
+	cmp, err := newComparator("hash", HashSHA256)
+	if err != nil {
+		t.Fatalf("newComparator: %v", err)
+	}
+	coll := runComparisons(src, "/root", dst, "/root", cmp, 1, false, NewFilter(nil, nil, nil), false, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts after first hash run, got %v", conflicts)
+	}
+
+	// The manifest each side just wrote records that side's a.txt mtime, and
+	// the two memFS seeds were written at different times, so without
+	// the walker skipping manifestFileName this second run (even with a
+	// plain byte comparator) would report it as a content mismatch.
+	coll = runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, NewFilter(nil, nil, nil), false, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 0 {
+		t.Fatalf("expected manifestFileName to be skipped, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_StopsAtFirstConflictWithoutKeepGoing(t *testing.T) {
+	files := map[string]string{}
+	destFiles := map[string]string{}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("/root/%d.txt", i)
+		files[name] = "same"
+		destFiles[name] = "different"
+	}
+	src := seedMemFS(t, files)
+	dst := seedMemFS(t, destFiles)
+
+	coll := runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, NewFilter(nil, nil, nil), false, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 1 {
+		t.Fatalf("expected exactly one conflict without --keep-going, got %v", conflicts)
+	}
+}
+
+func TestRunComparisons_KeepGoingEnumeratesEveryConflict(t *testing.T) {
+	files := map[string]string{}
+	destFiles := map[string]string{}
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("/root/%d.txt", i)
+		files[name] = "same"
+		destFiles[name] = "different"
+	}
+	src := seedMemFS(t, files)
+	dst := seedMemFS(t, destFiles)
+
+	coll := runComparisons(src, "/root", dst, "/root", byteComparator{}, 1, false, NewFilter(nil, nil, nil), true, MetadataChecks{})
+	if conflicts := coll.Conflicts(); len(conflicts) != 5 {
+		t.Fatalf("expected --keep-going to enumerate all 5 conflicts, got %d: %v", len(conflicts), conflicts)
+	}
+}
+
+func TestRunDryRun_ListsFilesWithoutComparing(t *testing.T) {
+	src := seedMemFS(t, map[string]string{"/root/a.txt": "hello", "/root/skip.txt": "hello"})
+	dst := seedMemFS(t, map[string]string{"/root/a.txt": "different content that would normally conflict", "/root/skip.txt": "hello"})
+
+	var visited []string
+	filter := NewFilter(nil, []string{"skip.txt"}, nil)
+	coll := newCollector()
+	walk(src, "/root", dst, "/root", "/root", filter, coll, true, MetadataChecks{}, nil, func(j job) {
+		visited = append(visited, j.sourcePath)
+	})
+
+	if len(coll.Conflicts()) != 0 {
+		t.Fatalf("runDryRun's walk should never compare content, got conflicts %v", coll.Conflicts())
+	}
+	if len(visited) != 1 || visited[0] != "/root/a.txt" {
+		t.Fatalf("expected only a.txt to be visited (skip.txt excluded), got %v", visited)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ConflictKind classifies why a source/dest pair isn't safe to copy.
+type ConflictKind string
+
+const (
+	ConflictTypeMismatch    ConflictKind = "type_mismatch"
+	ConflictSizeMismatch    ConflictKind = "size_mismatch"
+	ConflictContentMismatch ConflictKind = "content_mismatch"
+	ConflictSymlinkMismatch ConflictKind = "symlink_mismatch"
+	ConflictHardlinkBreak   ConflictKind = "hardlink_break"
+	ConflictModeMismatch    ConflictKind = "mode_mismatch"
+	ConflictOwnerMismatch   ConflictKind = "owner_mismatch"
+)
+
+// Conflict is one structured record of a precopy conflict, shaped so
+// scripts driving precopy can consume --report output and auto-resolve
+// conflicts (rename, skip, prefer-newer) before the real copy runs.
+type Conflict struct {
+	PathSrc string       `json:"path_src"`
+	PathDst string       `json:"path_dst"`
+	Kind    ConflictKind `json:"kind"`
+	SizeSrc int64        `json:"size_src"`
+	SizeDst int64        `json:"size_dst"`
+	HashSrc string       `json:"hash_src,omitempty"`
+	HashDst string       `json:"hash_dst,omitempty"`
+	// PathSrc2 is only set for ConflictHardlinkBreak, where the conflict
+	// is between two SRC paths (hardlinked to each other) rather than a
+	// SRC/DEST pair: PathSrc/PathDst still name the first path's SRC/DEST
+	// copy, and PathSrc2 names the second path's SRC copy.
+	PathSrc2 string `json:"path_src2,omitempty"`
+}
+
+// String renders a Conflict the way precopy's text output always has.
+func (c Conflict) String() string {
+	switch c.Kind {
+	case ConflictTypeMismatch:
+		return fmt.Sprintf("'%s' and '%s' have different types", c.PathSrc, c.PathDst)
+	case ConflictSizeMismatch:
+		return fmt.Sprintf("'%s' and '%s' have different sizes", c.PathSrc, c.PathDst)
+	case ConflictSymlinkMismatch:
+		return fmt.Sprintf("'%s' and '%s' are symlinks to different targets", c.PathSrc, c.PathDst)
+	case ConflictHardlinkBreak:
+		return fmt.Sprintf("'%s' and '%s' are hardlinked in SRC but wouldn't be in DEST (checked against '%s')", c.PathSrc, c.PathSrc2, c.PathDst)
+	case ConflictModeMismatch:
+		return fmt.Sprintf("'%s' and '%s' have different permissions", c.PathSrc, c.PathDst)
+	case ConflictOwnerMismatch:
+		return fmt.Sprintf("'%s' and '%s' have different owners", c.PathSrc, c.PathDst)
+	default:
+		return fmt.Sprintf("'%s' and '%s' content differs", c.PathSrc, c.PathDst)
+	}
+}
+
+// writeReport renders conflicts to w in the requested format.
+func writeReport(format string, conflicts []Conflict, w io.Writer) error {
+	switch format {
+	case "", "text":
+		for _, c := range conflicts {
+			if _, err := fmt.Fprintln(w, c.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "json":
+		return json.NewEncoder(w).Encode(conflicts)
+
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, c := range conflicts {
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"path_src", "path_dst", "kind", "size_src", "size_dst", "hash_src", "hash_dst", "path_src2"}); err != nil {
+			return err
+		}
+		for _, c := range conflicts {
+			row := []string{
+				c.PathSrc, c.PathDst, string(c.Kind),
+				strconv.FormatInt(c.SizeSrc, 10), strconv.FormatInt(c.SizeDst, 10),
+				c.HashSrc, c.HashDst, c.PathSrc2,
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("unknown --report format %q", format)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteReport_JSONRoundTrips(t *testing.T) {
+	conflicts := []Conflict{
+		{PathSrc: "/src/a.txt", PathDst: "/dst/a.txt", Kind: ConflictContentMismatch, SizeSrc: 5, SizeDst: 5},
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport("json", conflicts, &buf); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+
+	var got []Conflict
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(got) != 1 || got[0] != conflicts[0] {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, conflicts)
+	}
+}
+
+func TestWriteReport_CSVIncludesHardlinkSecondPath(t *testing.T) {
+	conflicts := []Conflict{
+		{PathSrc: "/src/a.txt", PathDst: "/dst/a.txt", PathSrc2: "/src/b.txt", Kind: ConflictHardlinkBreak},
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport("csv", conflicts, &buf); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "/src/b.txt") {
+		t.Fatalf("expected csv output to include the second SRC path, got %q", out)
+	}
+}
+
+func TestWriteReport_TextUsesConflictString(t *testing.T) {
+	conflicts := []Conflict{{PathSrc: "/src/a.txt", PathDst: "/dst/a.txt", Kind: ConflictSizeMismatch}}
+
+	var buf bytes.Buffer
+	if err := writeReport("text", conflicts, &buf); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != conflicts[0].String() {
+		t.Fatalf("got %q, want %q", got, conflicts[0].String())
+	}
+}